@@ -0,0 +1,57 @@
+package vagrant
+
+import (
+	"fmt"
+	"os"
+)
+
+// BuilderId is the common builder ID for all post-processors in this
+// package. Packer only cares that artifacts from different post-processors
+// don't collide, so we reuse a single ID for the whole package.
+const BuilderId = "mitchellh.post-processor.vagrant"
+
+// Artifact is a packer.Artifact implementation that represents a Vagrant
+// box produced by one of this package's post-processors.
+type Artifact struct {
+	path     string
+	provider string
+}
+
+// NewArtifact creates a new Vagrant box artifact for the given provider,
+// wrapping the single box file at path.
+func NewArtifact(provider string, path string) *Artifact {
+	return &Artifact{
+		path:     path,
+		provider: provider,
+	}
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (a *Artifact) Files() []string {
+	return []string{a.path}
+}
+
+// Provider returns the Vagrant provider name (e.g. "virtualbox",
+// "vmware") this box was built for.
+func (a *Artifact) Provider() string {
+	return a.provider
+}
+
+func (*Artifact) Id() string {
+	return "Vagrant"
+}
+
+func (a *Artifact) String() string {
+	return fmt.Sprintf("'%s' Vagrant Box: %s", a.provider, a.path)
+}
+
+func (a *Artifact) State(name string) interface{} {
+	return nil
+}
+
+func (a *Artifact) Destroy() error {
+	return os.Remove(a.path)
+}
@@ -0,0 +1,98 @@
+package vagrant
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+)
+
+// Resource types from the CIM_ResourceAllocationSettingData schema that
+// OVF's VirtualHardwareSection reuses. We only care about a handful of
+// them for Vagrantfile templating.
+const (
+	ovfResourceTypeProcessor      = 3
+	ovfResourceTypeMemory         = 4
+	ovfResourceTypeIDEController  = 5
+	ovfResourceTypeSCSIController = 6
+	ovfResourceTypeEthernet       = 10
+	ovfResourceTypeSATAController = 20
+)
+
+type ovfEnvelope struct {
+	XMLName       xml.Name         `xml:"Envelope"`
+	VirtualSystem ovfVirtualSystem `xml:"VirtualSystem"`
+}
+
+type ovfVirtualSystem struct {
+	Hardware ovfVirtualHardwareSection `xml:"VirtualHardwareSection"`
+}
+
+type ovfVirtualHardwareSection struct {
+	Items []ovfItem `xml:"Item"`
+}
+
+type ovfItem struct {
+	ElementName     string `xml:"ElementName"`
+	ResourceType    int    `xml:"ResourceType"`
+	ResourceSubType string `xml:"ResourceSubType"`
+	VirtualQuantity int64  `xml:"VirtualQuantity"`
+	Address         string `xml:"Address"`
+}
+
+// OVFNic describes a single virtual network adapter found in an OVF's
+// hardware section.
+type OVFNic struct {
+	Slot string
+	Type string
+}
+
+// OVFDiskController describes a storage controller (IDE, SATA, SCSI)
+// found in an OVF's hardware section.
+type OVFDiskController struct {
+	Name string
+	Type string
+}
+
+// OVFHardware holds the subset of VirtualHardwareSection facts the
+// Vagrantfile templates care about.
+type OVFHardware struct {
+	CPUs        int
+	MemoryMB    int64
+	Nics        []OVFNic
+	Controllers []OVFDiskController
+}
+
+// ParseOVFHardware reads the VirtualHardwareSection out of the OVF at
+// path and summarizes the facts templates commonly need.
+func ParseOVFHardware(path string) (*OVFHardware, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var env ovfEnvelope
+	if err := xml.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+
+	hw := &OVFHardware{}
+	for _, item := range env.VirtualSystem.Hardware.Items {
+		switch item.ResourceType {
+		case ovfResourceTypeProcessor:
+			hw.CPUs += int(item.VirtualQuantity)
+		case ovfResourceTypeMemory:
+			hw.MemoryMB += item.VirtualQuantity
+		case ovfResourceTypeEthernet:
+			hw.Nics = append(hw.Nics, OVFNic{
+				Slot: item.Address,
+				Type: item.ResourceSubType,
+			})
+		case ovfResourceTypeIDEController, ovfResourceTypeSCSIController, ovfResourceTypeSATAController:
+			hw.Controllers = append(hw.Controllers, OVFDiskController{
+				Name: item.ElementName,
+				Type: item.ResourceSubType,
+			})
+		}
+	}
+
+	return hw, nil
+}
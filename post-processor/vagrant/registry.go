@@ -0,0 +1,107 @@
+package vagrant
+
+import (
+	"fmt"
+	"github.com/mitchellh/packer/packer"
+)
+
+// PostProcessorFactory constructs a fresh, unconfigured post-processor.
+type PostProcessorFactory func() packer.PostProcessor
+
+// providerRegistry maps a Vagrant provider name to the post-processor
+// that knows how to turn that provider's builder artifacts into a box.
+// "qemu", "aws", and "docker" are provider names that builderIdProviders
+// maps builder ids to, but no box post-processor is registered for them.
+var providerRegistry = map[string]PostProcessorFactory{
+	"virtualbox": func() packer.PostProcessor { return &VBoxBoxPostProcessor{} },
+	"vmware":     func() packer.PostProcessor { return &VMwareBoxPostProcessor{} },
+}
+
+// builderIdProviders maps a builder's BuilderId, as reported by
+// packer.Artifact.BuilderId(), to the Vagrant provider name it produces
+// artifacts for.
+var builderIdProviders = map[string]string{
+	"mitchellh.virtualbox":      "virtualbox",
+	"mitchellh.vmware":          "vmware",
+	"mitchellh.qemu":            "qemu",
+	"mitchellh.amazonebs":       "aws",
+	"mitchellh.amazon.instance": "aws",
+	"packer.docker":             "docker",
+}
+
+// namedRegistry maps a post-processor name, as used in a sequence step's
+// "type", to its factory. It holds the dispatching "vagrant" box
+// post-processor and the "vagrant-cloud" uploader; the per-provider box
+// post-processors and SequencePostProcessor are not registered by name.
+var namedRegistry = map[string]PostProcessorFactory{
+	"vagrant":       func() packer.PostProcessor { return &BoxPostProcessor{} },
+	"vagrant-cloud": func() packer.PostProcessor { return &VagrantCloudPostProcessor{} },
+}
+
+// ProviderForBuilderId returns the Vagrant provider name registered for
+// the given builder ID, and whether one was found.
+func ProviderForBuilderId(builderId string) (string, bool) {
+	name, ok := builderIdProviders[builderId]
+	return name, ok
+}
+
+// PostProcessorForProvider returns a new, unconfigured post-processor
+// registered for the given Vagrant provider name.
+func PostProcessorForProvider(provider string) (packer.PostProcessor, error) {
+	factory, ok := providerRegistry[provider]
+	if !ok {
+		return nil, fmt.Errorf(
+			"no vagrant box post-processor registered for provider %q", provider)
+	}
+
+	return factory(), nil
+}
+
+// PostProcessorForArtifact looks up the post-processor registered for
+// the builder that produced artifact.
+func PostProcessorForArtifact(artifact packer.Artifact) (packer.PostProcessor, error) {
+	provider, ok := ProviderForBuilderId(artifact.BuilderId())
+	if !ok {
+		return nil, fmt.Errorf(
+			"no vagrant box post-processor registered for builder id %q",
+			artifact.BuilderId())
+	}
+
+	return PostProcessorForProvider(provider)
+}
+
+// PostProcessorByName returns a new, unconfigured post-processor
+// registered under name, for use as a sequence step.
+func PostProcessorByName(name string) (packer.PostProcessor, error) {
+	factory, ok := namedRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown vagrant post-processor %q", name)
+	}
+
+	return factory(), nil
+}
+
+// BoxPostProcessor dispatches to the box post-processor registered for
+// whatever builder produced its input artifact, so a single "vagrant"
+// post-processor in a template works across builder types.
+type BoxPostProcessor struct {
+	raws []interface{}
+}
+
+func (p *BoxPostProcessor) Configure(raws ...interface{}) error {
+	p.raws = raws
+	return nil
+}
+
+func (p *BoxPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	pp, err := PostProcessorForArtifact(artifact)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := pp.Configure(p.raws...); err != nil {
+		return nil, false, err
+	}
+
+	return pp.PostProcess(ui, artifact)
+}
@@ -0,0 +1,74 @@
+package vagrant
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/mitchellh/packer/packer"
+)
+
+// SequenceStep is a single stage of a SequencePostProcessor: Type names a
+// post-processor registered in this package (e.g. "vagrant",
+// "vagrant-cloud"), and Config is that post-processor's own configuration.
+type SequenceStep struct {
+	Type   string                 `mapstructure:"type"`
+	Config map[string]interface{} `mapstructure:"config"`
+}
+
+type SequenceConfig struct {
+	Steps []SequenceStep `mapstructure:"sequence"`
+}
+
+// SequencePostProcessor runs a list of this package's post-processors in
+// order, feeding each stage's output artifact to the next. This lets a
+// single post-processor entry in a template do e.g. vagrant box ->
+// vagrant-cloud upload, instead of requiring packer's own (builder-level)
+// post-processor chaining.
+type SequencePostProcessor struct {
+	config SequenceConfig
+}
+
+func (p *SequencePostProcessor) Configure(raws ...interface{}) error {
+	for _, raw := range raws {
+		if err := mapstructure.Decode(raw, &p.config); err != nil {
+			return err
+		}
+	}
+
+	if len(p.config.Steps) == 0 {
+		return errors.New("vagrant sequence post-processor requires at least one step")
+	}
+
+	return nil
+}
+
+// PostProcess runs each configured step against the artifact produced by
+// the previous one (or the original input, for the first step). If a
+// step errors, the sequence aborts immediately and that error is
+// returned; no further steps run. The final "keep the input artifact"
+// result is true if any step asked to keep its input.
+func (p *SequencePostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	keep := false
+	current := artifact
+
+	for i, step := range p.config.Steps {
+		pp, err := PostProcessorByName(step.Type)
+		if err != nil {
+			return nil, false, fmt.Errorf("sequence step %d: %s", i, err)
+		}
+
+		if err := pp.Configure(step.Config); err != nil {
+			return nil, false, fmt.Errorf("sequence step %d (%s): %s", i, step.Type, err)
+		}
+
+		next, stepKeep, err := pp.PostProcess(ui, current)
+		if err != nil {
+			return nil, false, fmt.Errorf("sequence step %d (%s): %s", i, step.Type, err)
+		}
+
+		keep = keep || stepKeep
+		current = next
+	}
+
+	return current, keep, nil
+}
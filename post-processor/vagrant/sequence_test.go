@@ -0,0 +1,138 @@
+package vagrant
+
+import (
+	"errors"
+	"github.com/mitchellh/packer/packer"
+	"testing"
+)
+
+type testUi struct{}
+
+func (testUi) Ask(string) (string, error) { return "", nil }
+func (testUi) Say(string)                 {}
+func (testUi) Message(string)             {}
+func (testUi) Error(string)               {}
+func (testUi) Machine(string, ...string)  {}
+
+type testArtifact struct {
+	id string
+}
+
+func (a *testArtifact) BuilderId() string        { return "test" }
+func (a *testArtifact) Files() []string          { return []string{"test.box"} }
+func (a *testArtifact) Id() string               { return a.id }
+func (a *testArtifact) String() string           { return a.id }
+func (a *testArtifact) State(string) interface{} { return nil }
+func (a *testArtifact) Destroy() error           { return nil }
+
+// taggingPostProcessor appends its name to the input artifact's id, so
+// tests can assert on step ordering.
+type taggingPostProcessor struct {
+	name string
+	keep bool
+}
+
+func (p *taggingPostProcessor) Configure(raws ...interface{}) error { return nil }
+
+func (p *taggingPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	return &testArtifact{id: artifact.Id() + ">" + p.name}, p.keep, nil
+}
+
+type erroringPostProcessor struct{}
+
+func (erroringPostProcessor) Configure(raws ...interface{}) error { return nil }
+
+func (erroringPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	return nil, false, errors.New("boom")
+}
+
+func TestSequencePostProcessor_runsStepsInOrder(t *testing.T) {
+	namedRegistry["test-a"] = func() packer.PostProcessor { return &taggingPostProcessor{name: "a"} }
+	namedRegistry["test-b"] = func() packer.PostProcessor { return &taggingPostProcessor{name: "b"} }
+	defer delete(namedRegistry, "test-a")
+	defer delete(namedRegistry, "test-b")
+
+	p := &SequencePostProcessor{}
+	err := p.Configure(map[string]interface{}{
+		"sequence": []map[string]interface{}{
+			{"type": "test-a"},
+			{"type": "test-b"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Configure: %s", err)
+	}
+
+	result, _, err := p.PostProcess(testUi{}, &testArtifact{id: "start"})
+	if err != nil {
+		t.Fatalf("PostProcess: %s", err)
+	}
+
+	if result.Id() != "start>a>b" {
+		t.Fatalf("expected steps to run in order, got %q", result.Id())
+	}
+}
+
+func TestSequencePostProcessor_keepIsTrueIfAnyStepKeeps(t *testing.T) {
+	namedRegistry["test-keep"] = func() packer.PostProcessor {
+		return &taggingPostProcessor{name: "keep", keep: true}
+	}
+	namedRegistry["test-nokeep"] = func() packer.PostProcessor {
+		return &taggingPostProcessor{name: "nokeep"}
+	}
+	defer delete(namedRegistry, "test-keep")
+	defer delete(namedRegistry, "test-nokeep")
+
+	p := &SequencePostProcessor{}
+	err := p.Configure(map[string]interface{}{
+		"sequence": []map[string]interface{}{
+			{"type": "test-nokeep"},
+			{"type": "test-keep"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Configure: %s", err)
+	}
+
+	_, keep, err := p.PostProcess(testUi{}, &testArtifact{id: "start"})
+	if err != nil {
+		t.Fatalf("PostProcess: %s", err)
+	}
+
+	if !keep {
+		t.Fatal("expected keep to be true when any step asks to keep its input")
+	}
+}
+
+func TestSequencePostProcessor_abortsOnStepError(t *testing.T) {
+	namedRegistry["test-ok"] = func() packer.PostProcessor { return &taggingPostProcessor{name: "ok"} }
+	namedRegistry["test-err"] = func() packer.PostProcessor { return erroringPostProcessor{} }
+	namedRegistry["test-never"] = func() packer.PostProcessor { return &taggingPostProcessor{name: "never"} }
+	defer delete(namedRegistry, "test-ok")
+	defer delete(namedRegistry, "test-err")
+	defer delete(namedRegistry, "test-never")
+
+	p := &SequencePostProcessor{}
+	err := p.Configure(map[string]interface{}{
+		"sequence": []map[string]interface{}{
+			{"type": "test-ok"},
+			{"type": "test-err"},
+			{"type": "test-never"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Configure: %s", err)
+	}
+
+	result, _, err := p.PostProcess(testUi{}, &testArtifact{id: "start"})
+	if err == nil {
+		t.Fatalf("expected an error from the failing step to abort the sequence, got result %v", result)
+	}
+}
+
+func TestSequencePostProcessor_requiresAtLeastOneStep(t *testing.T) {
+	p := &SequencePostProcessor{}
+	if err := p.Configure(map[string]interface{}{}); err == nil {
+		t.Fatal("expected Configure to reject an empty sequence")
+	}
+}
@@ -0,0 +1,105 @@
+package vagrant
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// BoxEntry describes a single file that should end up in a Vagrant box
+// archive, either streamed in from disk (Path) or written verbatim from
+// memory (Data) for small generated files like the Vagrantfile and
+// metadata.json.
+type BoxEntry struct {
+	Name string
+	Path string
+	Data []byte
+}
+
+// StreamBox writes entries directly into a tar/compressed archive at dst
+// without staging them on disk first. CopyContents+DirToBox copies every
+// artifact file into a temp directory and then tars that directory,
+// which doubles disk usage and serializes the I/O for multi-gigabyte
+// artifacts; StreamBox reads each source file exactly once, streaming it
+// straight into the archive.
+func StreamBox(dst string, entries []BoxEntry, compression BoxCompression) error {
+	outputF, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer outputF.Close()
+
+	tarW, closers, err := newBoxTarWriter(outputF, compression)
+	if err != nil {
+		return err
+	}
+
+	if compression.Reproducible {
+		sorted := make([]BoxEntry, len(entries))
+		copy(sorted, entries)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+		entries = sorted
+	}
+
+	for _, entry := range entries {
+		if err := writeStreamEntry(tarW, entry, compression.Reproducible); err != nil {
+			return err
+		}
+	}
+
+	return closeAll(closers)
+}
+
+func writeStreamEntry(tarW *tar.Writer, entry BoxEntry, reproducible bool) error {
+	var header *tar.Header
+	var r io.Reader
+
+	if entry.Data != nil {
+		header = &tar.Header{
+			Name: entry.Name,
+			Mode: 0644,
+			Size: int64(len(entry.Data)),
+		}
+		r = bytes.NewReader(entry.Data)
+	} else {
+		f, err := os.Open(entry.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		header, err = tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		header.Name = entry.Name
+		r = f
+	}
+
+	if reproducible {
+		header.ModTime = reproducibleModTime
+		header.AccessTime = reproducibleModTime
+		header.ChangeTime = reproducibleModTime
+		header.Uid = 0
+		header.Gid = 0
+		header.Uname = ""
+		header.Gname = ""
+	} else if entry.Data != nil {
+		header.ModTime = time.Now()
+	}
+
+	if err := tarW.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(tarW, r)
+	return err
+}
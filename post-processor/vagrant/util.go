@@ -0,0 +1,301 @@
+package vagrant
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mitchellh/packer/packer"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// reproducibleModTime is the fixed mtime stamped onto every tar entry
+// when BoxCompression.Reproducible is set, so that byte-identical inputs
+// always produce a byte-identical box.
+var reproducibleModTime = time.Unix(0, 0).UTC()
+
+// defaultCompressionLevel is used when a post-processor's
+// compression_level config option is left unset. It's a *int on the
+// config structs specifically so that an explicit compression_level: 0
+// (store, no compression) can be told apart from "not set".
+const defaultCompressionLevel = 6
+
+// resolveCompressionLevel returns the configured compression level, or
+// defaultCompressionLevel if it was left unset.
+func resolveCompressionLevel(level *int) int {
+	if level != nil {
+		return *level
+	}
+
+	return defaultCompressionLevel
+}
+
+// outputPathTemplate is the data made available when interpolating the
+// "output" config option for a box post-processor.
+type outputPathTemplate struct {
+	ArtifactId string
+	BuildName  string
+	Provider   string
+}
+
+// ProcessOutputPath interpolates the given output path template, falling
+// back to a sane per-provider default if one wasn't given by the user.
+func ProcessOutputPath(path, buildName, provider string, artifact packer.Artifact) (string, error) {
+	if path == "" {
+		path = "packer_{{.BuildName}}_{{.Provider}}.box"
+	}
+
+	opTpl := &outputPathTemplate{
+		ArtifactId: artifact.Id(),
+		BuildName:  buildName,
+		Provider:   provider,
+	}
+
+	tBuf := new(bytes.Buffer)
+	t, err := template.New("output").Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("error parsing output template: %s", err)
+	}
+	if err := t.Execute(tBuf, opTpl); err != nil {
+		return "", fmt.Errorf("error processing output template: %s", err)
+	}
+
+	return filepath.Clean(tBuf.String()), nil
+}
+
+// CopyContents copies src, a file, to dst, creating any parent directories
+// of dst as necessary.
+func CopyContents(dst, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	fi, err := s.Stat()
+	if err != nil {
+		return err
+	}
+
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	_, err = io.Copy(d, s)
+	return err
+}
+
+// WriteMetadata writes the Vagrant box metadata.json file into dir.
+func WriteMetadata(dir string, contents map[string]string) error {
+	f, err := os.Create(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(contents)
+}
+
+// BoxCompression controls how DirToBox packages a box's contents.
+type BoxCompression struct {
+	// Level is the compression level passed to the underlying compressor,
+	// 0 through 9 (best). For gzip, 0 stores without compression; zstd maps
+	// the level onto its own presets (see zstdEncoderLevel), so 0 there is
+	// its fastest setting and still compresses. Ignored when Algorithm is
+	// "none".
+	Level int
+
+	// Algorithm is one of "gzip", "zstd", or "none".
+	Algorithm string
+
+	// Reproducible forces deterministic tar output: entries are written
+	// in sorted order with a fixed mtime and zeroed uid/gid, so that
+	// repeated runs over identical inputs produce a byte-identical box.
+	Reproducible bool
+}
+
+// newBoxTarWriter wraps w with the compressor selected by compression.Algorithm
+// and returns a tar.Writer on top of it, along with the writers (innermost
+// first: the tar writer, then the compressor, if any) that must be closed
+// in order once the archive has been fully written, so that trailers get
+// flushed correctly. Both DirToBox and StreamBox build their archives on
+// top of this so the two paths can't drift in how they compress.
+func newBoxTarWriter(w io.Writer, compression BoxCompression) (*tar.Writer, []io.Closer, error) {
+	var compressor io.Closer
+
+	switch compression.Algorithm {
+	case "", "gzip":
+		gzipW, err := gzip.NewWriterLevel(w, compression.Level)
+		if err != nil {
+			return nil, nil, err
+		}
+		w = gzipW
+		compressor = gzipW
+	case "zstd":
+		zstdW, err := zstd.NewWriter(w,
+			zstd.WithEncoderLevel(zstdEncoderLevel(compression.Level)))
+		if err != nil {
+			return nil, nil, err
+		}
+		w = zstdW
+		compressor = zstdW
+	case "none":
+		// no compression, tar directly to w
+	default:
+		return nil, nil, fmt.Errorf("unknown compression_algorithm: %s", compression.Algorithm)
+	}
+
+	tarW := tar.NewWriter(w)
+	closers := []io.Closer{tarW}
+	if compressor != nil {
+		closers = append(closers, compressor)
+	}
+
+	return tarW, closers, nil
+}
+
+// closeAll closes each closer in order, returning the first error
+// encountered.
+func closeAll(closers []io.Closer) error {
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DirToBox tars and compresses the contents of dir into a Vagrant box
+// file at dst, per the given compression options.
+func DirToBox(dst, dir string, compression BoxCompression) error {
+	outputF, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer outputF.Close()
+
+	tarW, closers, err := newBoxTarWriter(outputF, compression)
+	if err != nil {
+		return err
+	}
+
+	entries, err := boxEntries(dir, compression.Reproducible)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := writeBoxEntry(tarW, entry, compression.Reproducible); err != nil {
+			return err
+		}
+	}
+
+	return closeAll(closers)
+}
+
+// zstdEncoderLevel maps our 0-9 compression_level scale onto zstd's
+// coarser speed/ratio presets.
+func zstdEncoderLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level <= 1:
+		return zstd.SpeedFastest
+	case level <= 5:
+		return zstd.SpeedDefault
+	case level <= 8:
+		return zstd.SpeedBetterCompression
+	default:
+		return zstd.SpeedBestCompression
+	}
+}
+
+type boxEntry struct {
+	path string
+	info os.FileInfo
+	name string
+}
+
+// boxEntries walks dir and returns its contents, sorted by archive name
+// when reproducible output was requested so that two runs over the same
+// input directory always write tar entries in the same order.
+func boxEntries(dir string, reproducible bool) ([]boxEntry, error) {
+	var entries []boxEntry
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, boxEntry{
+			path: path,
+			info: info,
+			name: filepath.ToSlash(relPath),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reproducible {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+
+	return entries, nil
+}
+
+func writeBoxEntry(tarW *tar.Writer, entry boxEntry, reproducible bool) error {
+	header, err := tar.FileInfoHeader(entry.info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = entry.name
+
+	if reproducible {
+		header.ModTime = reproducibleModTime
+		header.AccessTime = reproducibleModTime
+		header.ChangeTime = reproducibleModTime
+		header.Uid = 0
+		header.Gid = 0
+		header.Uname = ""
+		header.Gname = ""
+	}
+
+	if err := tarW.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if entry.info.IsDir() {
+		return nil
+	}
+
+	f, err := os.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tarW, f)
+	return err
+}
@@ -0,0 +1,129 @@
+package vagrant
+
+import (
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/mitchellh/packer/packer"
+)
+
+// VagrantCloudConfig configures the VagrantCloudPostProcessor. It is meant
+// to be chained after a box post-processor (VBoxBoxPostProcessor,
+// VMwareBoxPostProcessor, ...) via a post-processor sequence in the
+// template, so that a single `packer build` can go builder -> box ->
+// published release.
+type VagrantCloudConfig struct {
+	AccessToken     string `mapstructure:"access_token"`
+	BoxTag          string `mapstructure:"box_tag"`
+	Version         string `mapstructure:"version"`
+	VersionDesc     string `mapstructure:"version_description"`
+	NoRelease       bool   `mapstructure:"no_release"`
+	BoxDownloadUrl  string `mapstructure:"box_download_url"`
+	VagrantCloudUrl string `mapstructure:"vagrant_cloud_url"`
+}
+
+type VagrantCloudPostProcessor struct {
+	config VagrantCloudConfig
+	client *vagrantCloudClient
+}
+
+func (p *VagrantCloudPostProcessor) Configure(raws ...interface{}) error {
+	for _, raw := range raws {
+		if err := mapstructure.Decode(raw, &p.config); err != nil {
+			return err
+		}
+	}
+
+	if p.config.AccessToken == "" {
+		return fmt.Errorf("vagrant-cloud post-processor requires an access_token")
+	}
+	if p.config.BoxTag == "" {
+		return fmt.Errorf("vagrant-cloud post-processor requires a box_tag")
+	}
+	if p.config.Version == "" {
+		return fmt.Errorf("vagrant-cloud post-processor requires a version")
+	}
+
+	if p.config.VagrantCloudUrl == "" {
+		p.config.VagrantCloudUrl = "https://vagrantcloud.com/api/v1"
+	}
+
+	p.client = newVagrantCloudClient(p.config.VagrantCloudUrl, p.config.AccessToken)
+	return nil
+}
+
+// PostProcess expects artifact to be the output of a box post-processor
+// (i.e. a single .box file on disk) and publishes it as a provider of the
+// configured box version on Vagrant Cloud.
+func (p *VagrantCloudPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	boxPath, err := soleBoxFile(artifact)
+	if err != nil {
+		return nil, false, err
+	}
+
+	boxArtifact, ok := artifact.(*Artifact)
+	if !ok {
+		return nil, false, fmt.Errorf(
+			"vagrant-cloud post-processor must be chained after the " +
+				"vagrant box post-processor")
+	}
+
+	provider := vagrantCloudProviderName(boxArtifact.Provider())
+
+	ui.Message(fmt.Sprintf("Preparing to upload box for provider: %s", provider))
+
+	if err := p.client.EnsureBoxVersion(p.config.BoxTag, p.config.Version, p.config.VersionDesc); err != nil {
+		return nil, false, err
+	}
+
+	if err := p.client.EnsureProvider(p.config.BoxTag, p.config.Version, provider, p.config.BoxDownloadUrl); err != nil {
+		return nil, false, err
+	}
+
+	if p.config.BoxDownloadUrl == "" {
+		ui.Message(fmt.Sprintf("Uploading box: %s", boxPath))
+		uploadPath, err := p.client.UploadPath(p.config.BoxTag, p.config.Version, provider)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err := p.client.Upload(uploadPath, boxPath); err != nil {
+			return nil, false, err
+		}
+	} else {
+		ui.Message(fmt.Sprintf("Box is self-hosted at %s, skipping upload", p.config.BoxDownloadUrl))
+	}
+
+	if !p.config.NoRelease {
+		ui.Message(fmt.Sprintf("Releasing version %s of box %s", p.config.Version, p.config.BoxTag))
+		if err := p.client.Release(p.config.BoxTag, p.config.Version); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return artifact, true, nil
+}
+
+// soleBoxFile returns the single file an upstream box post-processor's
+// artifact is expected to contain.
+func soleBoxFile(artifact packer.Artifact) (string, error) {
+	files := artifact.Files()
+	if len(files) != 1 {
+		return "", fmt.Errorf(
+			"vagrant-cloud post-processor expects a single box file as its "+
+				"input artifact, got %d files; chain it after the vagrant "+
+				"box post-processor", len(files))
+	}
+
+	return files[0], nil
+}
+
+// vagrantCloudProviderName maps the provider names this package's box
+// post-processors use internally to the names Vagrant Cloud expects.
+func vagrantCloudProviderName(provider string) string {
+	switch provider {
+	case "vmware":
+		return "vmware_desktop"
+	default:
+		return provider
+	}
+}
@@ -0,0 +1,181 @@
+package vagrant
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// vagrantCloudClient is a minimal client for the parts of the Vagrant
+// Cloud box API that VagrantCloudPostProcessor needs: creating a box
+// version and provider, requesting a direct upload URL, uploading the box
+// itself, and releasing the version.
+type vagrantCloudClient struct {
+	baseUrl     string
+	accessToken string
+	http        *http.Client
+}
+
+func newVagrantCloudClient(baseUrl, accessToken string) *vagrantCloudClient {
+	return &vagrantCloudClient{
+		baseUrl:     baseUrl,
+		accessToken: accessToken,
+		http:        http.DefaultClient,
+	}
+}
+
+// EnsureBoxVersion creates the given version of box if it doesn't already
+// exist. Vagrant Cloud returns a 422 for a version that's already present,
+// which we treat as success.
+func (c *vagrantCloudClient) EnsureBoxVersion(boxTag, version, description string) error {
+	body := map[string]interface{}{
+		"version": map[string]string{
+			"version":     version,
+			"description": description,
+		},
+	}
+
+	path := fmt.Sprintf("/box/%s/versions", boxTag)
+	return c.postIgnoringDuplicate(path, body)
+}
+
+// EnsureProvider creates the given provider under the box version if it
+// doesn't already exist.
+func (c *vagrantCloudClient) EnsureProvider(boxTag, version, provider, downloadUrl string) error {
+	providerBody := map[string]string{"name": provider}
+	if downloadUrl != "" {
+		providerBody["url"] = downloadUrl
+	}
+
+	body := map[string]interface{}{"provider": providerBody}
+
+	path := fmt.Sprintf("/box/%s/version/%s/providers", boxTag, version)
+	return c.postIgnoringDuplicate(path, body)
+}
+
+// UploadPath requests a direct upload URL for the given box provider.
+func (c *vagrantCloudClient) UploadPath(boxTag, version, provider string) (string, error) {
+	path := fmt.Sprintf("/box/%s/version/%s/provider/%s/upload", boxTag, version, provider)
+
+	resp, err := c.do("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", c.errorFromResponse(resp)
+	}
+
+	var result struct {
+		UploadPath string `json:"upload_path"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding upload path response: %s", err)
+	}
+
+	return result.UploadPath, nil
+}
+
+// Upload PUTs the box file at boxPath to the given pre-signed upload URL.
+func (c *vagrantCloudClient) Upload(uploadPath, boxPath string) error {
+	f, err := os.Open(boxPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", uploadPath, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error uploading box: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return c.errorFromResponse(resp)
+	}
+
+	return nil
+}
+
+// Release marks the given box version as released, making it the active
+// version users without an explicit version constraint will pull.
+func (c *vagrantCloudClient) Release(boxTag, version string) error {
+	path := fmt.Sprintf("/box/%s/version/%s/release", boxTag, version)
+
+	resp, err := c.do("PUT", path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return c.errorFromResponse(resp)
+	}
+
+	return nil
+}
+
+func (c *vagrantCloudClient) postIgnoringDuplicate(path string, body interface{}) error {
+	resp, err := c.do("POST", path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 422 {
+		return c.errorFromResponse(resp)
+	}
+
+	return nil
+}
+
+func (c *vagrantCloudClient) do(method, path string, body interface{}) (*http.Response, error) {
+	u, err := url.Parse(c.baseUrl + path)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("access_token", c.accessToken)
+	u.RawQuery = q.Encode()
+
+	var bodyReader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(encoded)
+	} else {
+		bodyReader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, u.String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.http.Do(req)
+}
+
+func (c *vagrantCloudClient) errorFromResponse(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("vagrant cloud API error (%d): %s", resp.StatusCode, string(data))
+}
@@ -1,6 +1,8 @@
 package vagrant
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
@@ -15,14 +17,50 @@ import (
 )
 
 type VBoxBoxConfig struct {
-	OutputPath          string `mapstructure:"output"`
-	VagrantfileTemplate string `mapstructure:"vagrantfile_template"`
+	OutputPath                string            `mapstructure:"output"`
+	VagrantfileTemplate       string            `mapstructure:"vagrantfile_template"`
+	VagrantfileTemplateInline []string          `mapstructure:"vagrantfile_template_inline"`
+	BoxName                   string            `mapstructure:"box_name"`
+	BoxVersion                string            `mapstructure:"box_version"`
+	CustomData                map[string]string `mapstructure:"custom_data"`
+
+	// CompressionLevel is a pointer so that an explicit
+	// compression_level: 0 (store, no compression) can be told apart
+	// from the option being left unset.
+	CompressionLevel     *int   `mapstructure:"compression_level"`
+	CompressionAlgorithm string `mapstructure:"compression_algorithm"`
+	Reproducible         bool   `mapstructure:"reproducible"`
+
+	// StagingDir, if set, switches back to the old copy-then-tar
+	// behavior: every artifact file is copied into this directory before
+	// being archived, and the directory is left behind afterwards for
+	// inspection. Useful when debugging what actually went into a box.
+	StagingDir string `mapstructure:"staging_dir"`
 
 	PackerBuildName string `mapstructure:"packer_build_name"`
 }
 
+// VBoxVagrantfileTemplate is the data made available to the
+// vagrantfile_template (or vagrantfile_template_inline) while building a
+// VirtualBox Vagrant box.
 type VBoxVagrantfileTemplate struct {
+	ArtifactId string
+	BuildName  string
+	Provider   string
+	BoxName    string
+	BoxVersion string
+
 	BaseMacAddress string
+
+	// Hardware facts parsed out of the artifact's OVF, for templates that
+	// want to render provider blocks (cpus, memory, NICs, ...) without
+	// hand-maintaining them alongside the builder config.
+	Hardware *OVFHardware
+
+	// CustomData is passed straight through from the post-processor's
+	// custom_data config option, for anything the built-in fields don't
+	// cover (synced folders, networking, etc).
+	CustomData map[string]string
 }
 
 type VBoxBoxPostProcessor struct {
@@ -37,13 +75,34 @@ func (p *VBoxBoxPostProcessor) Configure(raws ...interface{}) error {
 		}
 	}
 
+	if p.config.CompressionAlgorithm == "" {
+		p.config.CompressionAlgorithm = "gzip"
+	}
+
 	return nil
 }
 
 func (p *VBoxBoxPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
-	var err error
-	tplData := &VBoxVagrantfileTemplate{}
-	tplData.BaseMacAddress, err = p.findBaseMacAddress(artifact)
+	ovfPath, err := p.findOVF(artifact)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tplData := &VBoxVagrantfileTemplate{
+		ArtifactId: artifact.Id(),
+		BuildName:  p.config.PackerBuildName,
+		Provider:   "virtualbox",
+		BoxName:    p.config.BoxName,
+		BoxVersion: p.config.BoxVersion,
+		CustomData: p.config.CustomData,
+	}
+
+	tplData.BaseMacAddress, err = p.findBaseMacAddress(ovfPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tplData.Hardware, err = ParseOVFHardware(ovfPath)
 	if err != nil {
 		return nil, false, err
 	}
@@ -55,79 +114,141 @@ func (p *VBoxBoxPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifac
 		return nil, false, err
 	}
 
-	// Create a temporary directory for us to build the contents of the box in
-	dir, err := ioutil.TempDir("", "packer")
+	vagrantfileContents, err := p.renderVagrantfile(tplData)
+	if err != nil {
+		return nil, false, err
+	}
+
+	metadata, err := json.Marshal(map[string]string{"provider": "virtualbox"})
+	if err != nil {
+		return nil, false, err
+	}
+
+	compression := BoxCompression{
+		Level:        resolveCompressionLevel(p.config.CompressionLevel),
+		Algorithm:    p.config.CompressionAlgorithm,
+		Reproducible: p.config.Reproducible,
+	}
+
+	if p.config.StagingDir != "" {
+		err = p.postProcessStaged(ui, artifact, outputPath, vagrantfileContents, metadata, compression)
+	} else {
+		err = p.postProcessStreamed(ui, artifact, ovfPath, outputPath, vagrantfileContents, metadata, compression)
+	}
 	if err != nil {
 		return nil, false, err
 	}
-	defer os.RemoveAll(dir)
 
-	// Copy all of the original contents into the temporary directory
+	return NewArtifact("virtualbox", outputPath), false, nil
+}
+
+// postProcessStreamed writes the box straight to outputPath without
+// staging it on disk first, per StreamBox.
+func (p *VBoxBoxPostProcessor) postProcessStreamed(ui packer.Ui, artifact packer.Artifact, ovfPath, outputPath string, vagrantfileContents, metadata []byte, compression BoxCompression) error {
+	entries := make([]BoxEntry, 0, len(artifact.Files())+2)
+	for _, path := range artifact.Files() {
+		ui.Message(fmt.Sprintf("Streaming: %s", path))
+
+		name := filepath.Base(path)
+		if path == ovfPath {
+			// Rename the OVF to box.ovf, as required by Vagrant. Since
+			// we're streaming straight into the archive, this is just a
+			// header name rewrite rather than an on-disk rename.
+			name = "box.ovf"
+		}
+
+		entries = append(entries, BoxEntry{Name: name, Path: path})
+	}
+
+	entries = append(entries,
+		BoxEntry{Name: "Vagrantfile", Data: vagrantfileContents},
+		BoxEntry{Name: "metadata.json", Data: metadata})
+
+	ui.Message(fmt.Sprintf("Compressing box..."))
+	return StreamBox(outputPath, entries, compression)
+}
+
+// postProcessStaged reproduces the historical copy-then-tar behavior: all
+// artifact files are copied into p.config.StagingDir, which is left
+// behind afterwards so the contents of the box can be inspected.
+func (p *VBoxBoxPostProcessor) postProcessStaged(ui packer.Ui, artifact packer.Artifact, outputPath string, vagrantfileContents, metadata []byte, compression BoxCompression) error {
+	dir := p.config.StagingDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
 	for _, path := range artifact.Files() {
 		ui.Message(fmt.Sprintf("Copying: %s", path))
 
 		dstPath := filepath.Join(dir, filepath.Base(path))
 		if err := CopyContents(dstPath, path); err != nil {
-			return nil, false, err
+			return err
 		}
 	}
 
-	// Create the Vagrantfile from the template
-	vf, err := os.Create(filepath.Join(dir, "Vagrantfile"))
-	if err != nil {
-		return nil, false, err
+	if err := ioutil.WriteFile(filepath.Join(dir, "Vagrantfile"), vagrantfileContents, 0644); err != nil {
+		return err
 	}
-	defer vf.Close()
 
+	if err := ioutil.WriteFile(filepath.Join(dir, "metadata.json"), metadata, 0644); err != nil {
+		return err
+	}
+
+	ui.Message("Renaming the OVF to box.ovf...")
+	if err := p.renameOVF(dir); err != nil {
+		return err
+	}
+
+	ui.Message(fmt.Sprintf("Compressing box..."))
+	return DirToBox(outputPath, dir, compression)
+}
+
+// renderVagrantfile executes the configured Vagrantfile template (or the
+// package default) against tplData.
+func (p *VBoxBoxPostProcessor) renderVagrantfile(tplData *VBoxVagrantfileTemplate) ([]byte, error) {
 	vagrantfileContents := defaultVBoxVagrantfile
-	if p.config.VagrantfileTemplate != "" {
+	switch {
+	case len(p.config.VagrantfileTemplateInline) > 0:
+		vagrantfileContents = strings.Join(p.config.VagrantfileTemplateInline, "\n")
+	case p.config.VagrantfileTemplate != "":
 		f, err := os.Open(p.config.VagrantfileTemplate)
 		if err != nil {
-			return nil, false, err
+			return nil, err
 		}
 		defer f.Close()
 
 		contents, err := ioutil.ReadAll(f)
 		if err != nil {
-			return nil, false, err
+			return nil, err
 		}
 
 		vagrantfileContents = string(contents)
 	}
 
-	t := template.Must(template.New("vagrantfile").Parse(vagrantfileContents))
-	t.Execute(vf, tplData)
-	vf.Close()
-
-	// Create the metadata
-	metadata := map[string]string{"provider": "virtualbox"}
-	if err := WriteMetadata(dir, metadata); err != nil {
-		return nil, false, err
-	}
-
-	// Rename the OVF file to box.ovf, as required by Vagrant
-	ui.Message("Renaming the OVF to box.ovf...")
-	if err := p.renameOVF(dir); err != nil {
-		return nil, false, err
+	t, err := template.New("vagrantfile").Parse(vagrantfileContents)
+	if err != nil {
+		return nil, err
 	}
 
-	// Compress the directory to the given output path
-	ui.Message(fmt.Sprintf("Compressing box..."))
-	if err := DirToBox(outputPath, dir); err != nil {
-		return nil, false, err
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, tplData); err != nil {
+		return nil, err
 	}
 
-	return NewArtifact("virtualbox", outputPath), false, nil
+	return buf.Bytes(), nil
 }
 
-func (p *VBoxBoxPostProcessor) findBaseMacAddress(a packer.Artifact) (string, error) {
-	log.Println("Looking for OVF for base mac address...")
+// findOVF locates the single OVF file within the artifact's files.
+func (p *VBoxBoxPostProcessor) findOVF(a packer.Artifact) (string, error) {
+	log.Println("Looking for OVF in artifact...")
+
 	var ovf string
 	for _, f := range a.Files() {
 		if strings.HasSuffix(f, ".ovf") {
-			log.Printf("OVF found: %s", f)
+			if ovf != "" {
+				return "", errors.New("More than one OVF file in VirtualBox artifact.")
+			}
 			ovf = f
-			break
 		}
 	}
 
@@ -135,13 +256,12 @@ func (p *VBoxBoxPostProcessor) findBaseMacAddress(a packer.Artifact) (string, er
 		return "", errors.New("ovf file couldn't be found")
 	}
 
-	f, err := os.Open(ovf)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
+	log.Printf("OVF found: %s", ovf)
+	return ovf, nil
+}
 
-	data, err := ioutil.ReadAll(f)
+func (p *VBoxBoxPostProcessor) findBaseMacAddress(ovf string) (string, error) {
+	data, err := ioutil.ReadFile(ovf)
 	if err != nil {
 		return "", err
 	}
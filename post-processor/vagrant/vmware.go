@@ -0,0 +1,262 @@
+package vagrant
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+type VMwareBoxConfig struct {
+	OutputPath          string `mapstructure:"output"`
+	VagrantfileTemplate string `mapstructure:"vagrantfile_template"`
+
+	// CompressionLevel is a pointer so that an explicit
+	// compression_level: 0 (store, no compression) can be told apart
+	// from the option being left unset.
+	CompressionLevel     *int   `mapstructure:"compression_level"`
+	CompressionAlgorithm string `mapstructure:"compression_algorithm"`
+	Reproducible         bool   `mapstructure:"reproducible"`
+
+	// StagingDir, if set, switches back to the old copy-then-tar
+	// behavior: every artifact file is copied into this directory before
+	// being archived, and the directory is left behind afterwards for
+	// inspection.
+	StagingDir string `mapstructure:"staging_dir"`
+
+	PackerBuildName string `mapstructure:"packer_build_name"`
+}
+
+type VMwareVagrantfileTemplate struct{}
+
+type VMwareBoxPostProcessor struct {
+	config VMwareBoxConfig
+}
+
+func (p *VMwareBoxPostProcessor) Configure(raws ...interface{}) error {
+	for _, raw := range raws {
+		err := mapstructure.Decode(raw, &p.config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.config.CompressionAlgorithm == "" {
+		p.config.CompressionAlgorithm = "gzip"
+	}
+
+	return nil
+}
+
+func (p *VMwareBoxPostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	vmxPath, err := p.findVMX(artifact)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Compile the output path
+	outputPath, err := ProcessOutputPath(p.config.OutputPath,
+		p.config.PackerBuildName, "vmware", artifact)
+	if err != nil {
+		return nil, false, err
+	}
+
+	vagrantfileContents, err := p.renderVagrantfile()
+	if err != nil {
+		return nil, false, err
+	}
+
+	metadata, err := json.Marshal(map[string]string{"provider": "vmware_desktop"})
+	if err != nil {
+		return nil, false, err
+	}
+
+	cleanedVMX, err := cleanVMX(vmxPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	compression := BoxCompression{
+		Level:        resolveCompressionLevel(p.config.CompressionLevel),
+		Algorithm:    p.config.CompressionAlgorithm,
+		Reproducible: p.config.Reproducible,
+	}
+
+	if p.config.StagingDir != "" {
+		err = p.postProcessStaged(ui, artifact, vmxPath, outputPath, vagrantfileContents, metadata, cleanedVMX, compression)
+	} else {
+		err = p.postProcessStreamed(ui, artifact, vmxPath, outputPath, vagrantfileContents, metadata, cleanedVMX, compression)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return NewArtifact("vmware", outputPath), false, nil
+}
+
+// postProcessStreamed writes the box straight to outputPath without
+// staging it on disk first, per StreamBox.
+func (p *VMwareBoxPostProcessor) postProcessStreamed(ui packer.Ui, artifact packer.Artifact, vmxPath, outputPath string, vagrantfileContents, metadata, cleanedVMX []byte, compression BoxCompression) error {
+	entries := make([]BoxEntry, 0, len(artifact.Files())+2)
+	for _, path := range artifact.Files() {
+		if path == vmxPath {
+			// The VMX gets renamed to box.vmx, with floppy/ISO drives
+			// stripped out of its contents, so it's written from memory
+			// rather than streamed from disk.
+			entries = append(entries, BoxEntry{Name: "box.vmx", Data: cleanedVMX})
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Streaming: %s", path))
+		entries = append(entries, BoxEntry{Name: filepath.Base(path), Path: path})
+	}
+
+	entries = append(entries,
+		BoxEntry{Name: "Vagrantfile", Data: vagrantfileContents},
+		BoxEntry{Name: "metadata.json", Data: metadata})
+
+	ui.Message(fmt.Sprintf("Compressing box..."))
+	return StreamBox(outputPath, entries, compression)
+}
+
+// postProcessStaged reproduces the historical copy-then-tar behavior: all
+// artifact files are copied into p.config.StagingDir, which is left
+// behind afterwards so the contents of the box can be inspected.
+func (p *VMwareBoxPostProcessor) postProcessStaged(ui packer.Ui, artifact packer.Artifact, vmxPath, outputPath string, vagrantfileContents, metadata, cleanedVMX []byte, compression BoxCompression) error {
+	dir := p.config.StagingDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, path := range artifact.Files() {
+		ui.Message(fmt.Sprintf("Copying: %s", path))
+
+		dstPath := filepath.Join(dir, filepath.Base(path))
+		if err := CopyContents(dstPath, path); err != nil {
+			return err
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Vagrantfile"), vagrantfileContents, 0644); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "metadata.json"), metadata, 0644); err != nil {
+		return err
+	}
+
+	ui.Message("Cleaning up the VMX prior to packaging...")
+	if err := os.Rename(filepath.Join(dir, filepath.Base(vmxPath)), filepath.Join(dir, "box.vmx")); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "box.vmx"), cleanedVMX, 0644); err != nil {
+		return err
+	}
+
+	ui.Message(fmt.Sprintf("Compressing box..."))
+	return DirToBox(outputPath, dir, compression)
+}
+
+// renderVagrantfile executes the configured Vagrantfile template (or the
+// package default).
+func (p *VMwareBoxPostProcessor) renderVagrantfile() ([]byte, error) {
+	vagrantfileContents := defaultVMwareVagrantfile
+	if p.config.VagrantfileTemplate != "" {
+		f, err := os.Open(p.config.VagrantfileTemplate)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		contents, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+
+		vagrantfileContents = string(contents)
+	}
+
+	t, err := template.New("vagrantfile").Parse(vagrantfileContents)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, &VMwareVagrantfileTemplate{}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// findVMX locates the single VMX file within the artifact's files.
+func (p *VMwareBoxPostProcessor) findVMX(a packer.Artifact) (string, error) {
+	log.Println("Looking for VMX in artifact...")
+
+	var vmx string
+	for _, f := range a.Files() {
+		if strings.HasSuffix(f, ".vmx") {
+			if vmx != "" {
+				return "", errors.New("More than one VMX file in VMware artifact.")
+			}
+			vmx = f
+		}
+	}
+
+	if vmx == "" {
+		return "", errors.New("no VMX file found in VMware artifact.")
+	}
+
+	log.Printf("VMX found: %s", vmx)
+	return vmx, nil
+}
+
+// cleanVMX strips the entire device stanza (every "prefix.key = ..."
+// line) for floppy0 and for any ide/sata/scsi device whose fileName
+// points at an ISO/FLP, from the VMX at path. Vagrant boxes ship without
+// the installation media the builder used; leaving behind a device's
+// "present"/"deviceType" lines with no matching fileName is exactly the
+// dangling reference that prevents the box from booting on another
+// machine, so the whole stanza has to go, not just the fileName line.
+func cleanVMX(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	mediaFileRe := regexp.MustCompile(`(?i)^((?:ide|sata|scsi)\d+:\d+)\.filename\s*=\s*".*\.(?:iso|flp)"\s*$`)
+	devicePrefixRe := regexp.MustCompile(`(?i)^((?:ide|sata|scsi)\d+:\d+|floppy\d+)\.`)
+
+	removePrefixes := map[string]bool{"floppy0": true}
+	for _, line := range lines {
+		if m := mediaFileRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			removePrefixes[strings.ToLower(m[1])] = true
+		}
+	}
+
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if m := devicePrefixRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil && removePrefixes[strings.ToLower(m[1])] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return []byte(strings.TrimSpace(strings.Join(kept, "\n")) + "\n"), nil
+}
+
+var defaultVMwareVagrantfile = `
+Vagrant.configure("2") do |config|
+end
+`
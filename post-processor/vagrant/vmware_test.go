@@ -0,0 +1,75 @@
+package vagrant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanVMX(t *testing.T) {
+	vmx := `.encoding = "UTF-8"
+config.version = "8"
+virtualHW.version = "14"
+scsi0.present = "TRUE"
+scsi0.virtualDev = "lsilogic"
+scsi0:0.present = "TRUE"
+scsi0:0.fileName = "disk-flat.vmdk"
+scsi0:0.deviceType = "scsi-hardDisk"
+scsi0:1.present = "TRUE"
+scsi0:1.deviceType = "cdrom-image"
+scsi0:1.fileName = "linux.iso"
+scsi0:1.startConnected = "TRUE"
+floppy0.present = "TRUE"
+floppy0.startConnected = "FALSE"
+floppy0.fileType = "file"
+floppy0.fileName = "floppy0"
+ethernet0.present = "TRUE"
+`
+
+	dir, err := ioutil.TempDir("", "vagrant-vmx")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "box.vmx")
+	if err := ioutil.WriteFile(path, []byte(vmx), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	cleaned, err := cleanVMX(path)
+	if err != nil {
+		t.Fatalf("cleanVMX: %s", err)
+	}
+	out := string(cleaned)
+
+	for _, line := range []string{
+		`scsi0:1.present`,
+		`scsi0:1.deviceType`,
+		`scsi0:1.fileName`,
+		`scsi0:1.startConnected`,
+		`floppy0.present`,
+		`floppy0.startConnected`,
+		`floppy0.fileType`,
+		`floppy0.fileName`,
+	} {
+		if strings.Contains(out, line) {
+			t.Errorf("expected %q to be stripped, but it's still present:\n%s", line, out)
+		}
+	}
+
+	for _, line := range []string{
+		`scsi0.present`,
+		`scsi0.virtualDev`,
+		`scsi0:0.present`,
+		`scsi0:0.fileName`,
+		`scsi0:0.deviceType`,
+		`ethernet0.present`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q to survive cleanVMX, but it's gone:\n%s", line, out)
+		}
+	}
+}